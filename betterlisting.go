@@ -4,6 +4,8 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -14,6 +16,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 const betterListingTemplate = `
@@ -156,6 +159,51 @@ th.sorting-down::after {
 
   const database = firebase.database();
 </script>
+{{else if .StateWSEnabled}}
+<script>
+  // Speaks the {op, key, value} protocol served by /api/state/ws
+  // (see statews.go), behind the same database.ref(...).on/child
+  // shape the Firebase branch above provides, so the script below doesn't
+  // need to know which backend is in use.
+  const stateSocket = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/api/state/ws');
+  const statePending = [];
+  const stateSubscribers = {};
+  function stateSend(msg) {
+      if (stateSocket.readyState === WebSocket.OPEN) {
+          stateSocket.send(JSON.stringify(msg));
+      } else {
+          statePending.push(msg);
+      }
+  }
+  stateSocket.addEventListener('open', () => {
+      while (statePending.length) stateSend(statePending.shift());
+  });
+  stateSocket.addEventListener('message', ev => {
+      const msg = JSON.parse(ev.data);
+      if (msg.op === 'set' && stateSubscribers[msg.key]) {
+          stateSubscribers[msg.key](msg.value);
+      }
+  });
+  const database = {
+      ref(key) {
+          return {
+              on(event, cb) {
+                  stateSubscribers[key] = value => cb({ val: () => ({ checked: value }) });
+                  stateSend({op: 'sub', key: key});
+              },
+              child(field) {
+                  return {
+                      set(value) {
+                          stateSend({op: 'set', key: key, value: value});
+                      },
+                  };
+              },
+          };
+      },
+  };
+</script>
+{{end}}
+{{if or .FirebaseConfig .StateWSEnabled}}
 <script>
     const rows = tbody.find("tr");
     for (const rowElem of rows) {
@@ -217,7 +265,11 @@ type fileInfoEx struct {
 }
 
 type betterHttpListingServer struct {
-	root       http.FileSystem
+	root http.FileSystem
+	// rootDir is the filesystem path backing root, used by the upload
+	// handlers below. It is empty if root isn't a plain http.Dir, in
+	// which case writes are refused.
+	rootDir    string
 	fileServer http.Handler
 
 	hmacKey []byte
@@ -229,14 +281,33 @@ func newBetterHttpListingServer(root http.FileSystem) http.Handler {
 		hmacKeyArray := sha256.Sum256([]byte(*PathHashHMACKey))
 		hmacKey = hmacKeyArray[:]
 	}
+	var rootDir string
+	if dir, ok := root.(http.Dir); ok {
+		rootDir = string(dir)
+	}
 	return &betterHttpListingServer{
 		root:       root,
+		rootDir:    rootDir,
 		fileServer: http.FileServer(root),
 		hmacKey:    hmacKey,
 	}
 }
 
 func (s *betterHttpListingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		s.handlePut(w, r)
+		return
+	case http.MethodPost:
+		if strings.HasSuffix(r.URL.Path, "/") {
+			s.handlePost(w, r)
+			return
+		}
+	case http.MethodDelete:
+		s.handleDelete(w, r)
+		return
+	}
+
 	p := path.Clean(r.URL.Path)
 	if !strings.HasSuffix(r.URL.Path, "/") {
 		s.fileServer.ServeHTTP(w, r)
@@ -254,24 +325,27 @@ func (s *betterHttpListingServer) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (s *betterHttpListingServer) tryHandle(w http.ResponseWriter, r *http.Request, p string) error {
+// Readdir reads and sorts the directory at p, computing an HMAC path hash
+// per entry when s.hmacKey is set. It is shared by the HTML and JSON
+// listing paths in tryHandle.
+func (s *betterHttpListingServer) Readdir(p string) ([]fileInfoEx, error) {
 	f, err := s.root.Open(p)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	stat, err := f.Stat()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !stat.IsDir() {
-		return errWrongType
+		return nil, errWrongType
 	}
 
 	dirs, err := f.Readdir(-1)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	sort.Slice(dirs, func(i, j int) bool {
@@ -290,6 +364,106 @@ func (s *betterHttpListingServer) tryHandle(w http.ResponseWriter, r *http.Reque
 			dirsEx[i].PathHashString = base64.URLEncoding.EncodeToString(mac)
 		}
 	}
+	return dirsEx, nil
+}
+
+// dirListingETag computes a strong ETag from the sorted (name, size,
+// modtime) tuple of dirs, so unchanged listings let clients rely on 304s.
+func dirListingETag(dirs []fileInfoEx) string {
+	h := sha256.New()
+	for _, d := range dirs {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", d.Name(), d.Size(), d.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%q", hex.EncodeToString(h.Sum(nil)))
+}
+
+func dirListingLastModified(dirs []fileInfoEx) time.Time {
+	var newest time.Time
+	for _, d := range dirs {
+		if d.ModTime().After(newest) {
+			newest = d.ModTime()
+		}
+	}
+	return newest
+}
+
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func notModifiedSince(r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() {
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+func wantsJSONListing(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+type dirEntryJSON struct {
+	Name           string `json:"name"`
+	Size           int64  `json:"size"`
+	ModTimeRFC3339 string `json:"mod_time_rfc3339"`
+	IsDir          bool   `json:"is_dir"`
+	PathHash       string `json:"path_hash,omitempty"`
+}
+
+func (s *betterHttpListingServer) tryHandle(w http.ResponseWriter, r *http.Request, p string) error {
+	dirsEx, err := s.Readdir(p)
+	if err != nil {
+		return err
+	}
+
+	etag := dirListingETag(dirsEx)
+	lastModified := dirListingLastModified(dirsEx)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) || notModifiedSince(r, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if wantsJSONListing(r) {
+		entries := make([]dirEntryJSON, len(dirsEx))
+		for i, d := range dirsEx {
+			entries[i] = dirEntryJSON{
+				Name:           d.Name(),
+				Size:           d.Size(),
+				ModTimeRFC3339: d.ModTime().Format(time.RFC3339),
+				IsDir:          d.IsDir(),
+				PathHash:       d.PathHashString,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		return json.NewEncoder(w).Encode(entries)
+	}
 
 	var fbConfig *firebaseConfig
 	if *FirebaseAPIKey != "" {
@@ -301,18 +475,15 @@ func (s *betterHttpListingServer) tryHandle(w http.ResponseWriter, r *http.Reque
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	err = listingTemplate.Execute(w, struct {
+	return listingTemplate.Execute(w, struct {
 		Path           string
 		Dirs           []fileInfoEx
 		FirebaseConfig *firebaseConfig
+		StateWSEnabled bool
 	}{
 		p,
 		dirsEx,
 		fbConfig,
+		*StateDBPath != "",
 	})
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryHandleJSONListing(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofileserver-listing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &betterHttpListingServer{root: http.Dir(root)}
+
+	req := httptest.NewRequest(http.MethodGet, "/?format=json", nil)
+	rec := httptest.NewRecorder()
+
+	if err := s.tryHandle(rec, req, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+
+	var entries []dirEntryJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("response isn't valid JSON: %v (%q)", err, rec.Body.String())
+	}
+	if len(entries) != 1 || entries[0].Name != "a.txt" || entries[0].Size != 5 || entries[0].IsDir {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestTryHandleIfNoneMatchReturnsNotModified(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofileserver-listing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &betterHttpListingServer{root: http.Dir(root)}
+
+	first := httptest.NewRecorder()
+	if err := s.tryHandle(first, httptest.NewRequest(http.MethodGet, "/", nil), "/"); err != nil {
+		t.Fatal(err)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag header on the first response")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	if err := s.tryHandle(rec, req, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a matching If-None-Match, got %d", rec.Code)
+	}
+}
+
+func TestDirListingETagChangesWithContent(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofileserver-listing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	s := &betterHttpListingServer{root: http.Dir(root)}
+
+	before, err := s.Readdir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etagBefore := dirListingETag(before)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := s.Readdir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etagAfter := dirListingETag(after)
+
+	if etagBefore == etagAfter {
+		t.Fatal("expected the ETag to change once a file was added")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"io"
 	"log"
 	"log/syslog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -23,12 +24,40 @@ import (
 	"time"
 
 	"github.com/interarticle/gofileserver/httploghandler"
+	"github.com/interarticle/gofileserver/httptimeout"
+	"github.com/interarticle/gofileserver/logrotate"
+	"github.com/interarticle/gofileserver/proxyproto"
+	"github.com/interarticle/gofileserver/statestore"
 )
 
 var (
 	rootDirectory = flag.String("root_directory", "", "Path to the folder to be served")
 	bindAddress   = flag.String("bind_address", "", "IP and port to bind the server to")
 	logToSyslog   = flag.Bool("log_to_syslog", false, "Whether or not to log to Syslog")
+
+	minWriteBytesPerSec = flag.Int64("min_write_bytes_per_sec", 0, "Minimum sustained write throughput a client must maintain, or 0 to disable")
+	writeIdleTimeout    = flag.Duration("write_idle_timeout", 0, "Maximum time allowed between successive writes to a client, or 0 to disable")
+	maxRequestDuration  = flag.Duration("max_request_duration", 0, "Maximum total lifetime of a request, or 0 to disable")
+
+	logFile        = flag.String("log_file", "", "Path to a log file to write to, with rotation. If unset, logs go to stderr only")
+	logMaxSizeMB   = flag.Int64("log_max_size_mb", 100, "Rotate the log file once it reaches this size, in megabytes")
+	logMaxAgeHours = flag.Int64("log_max_age_hours", 0, "Rotate the log file once it has been open this many hours, or 0 to disable")
+	logMaxBackups  = flag.Int("log_max_backups", 10, "Number of rotated log segments to keep, or 0 for no count limit (segments older than --log_max_age_hours are still removed)")
+	logCompress    = flag.Bool("log_compress", true, "Whether to gzip rotated log segments")
+
+	logFormat = flag.String("log_format", "extended_legacy", "Access log encoding: extended_legacy, json, logfmt, or loki")
+
+	lokiPushURL       = flag.String("loki_push_url", "", "Loki push endpoint, e.g. http://loki:3100/loki/api/v1/push. Required when --log_format=loki")
+	lokiTenantID      = flag.String("loki_tenant_id", "", "X-Scope-OrgID header sent with every push, if set")
+	lokiLabels        = flag.String("loki_labels", "", "Comma-separated key=value labels attached to every pushed stream, e.g. job=gofileserver,env=prod")
+	lokiBatchSize     = flag.Int("loki_batch_size", 0, "Records buffered before a push is triggered, or 0 for the package default")
+	lokiFlushInterval = flag.Duration("loki_flush_interval", 0, "Maximum time a record waits before being pushed, or 0 for the package default")
+	lokiQueueSize     = flag.Int("loki_queue_size", 0, "Records held in memory before new ones are dropped, or 0 for the package default")
+
+	StateDBPath = flag.String("state_db_path", "", "Path to a bbolt database file for per-file \"seen\" state. Setting this enables the /api/state/ws endpoint")
+
+	proxyProtocolMode = flag.String("proxy_protocol", "off", "Whether to recover the real client address from a PROXY protocol v1/v2 header: off, optional, or required")
+	trustedProxyCIDRs = flag.String("trusted_proxy_cidrs", "", "Comma-separated CIDRs allowed to send a PROXY protocol header; connections from elsewhere are left alone. Empty trusts every source")
 )
 
 func main() {
@@ -36,6 +65,22 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	var logWriter io.Writer = os.Stderr
+	var rotatingLogWriter *logrotate.Writer
+
+	if *logFile != "" {
+		var err error
+		rotatingLogWriter, err = logrotate.NewWriter(logrotate.Config{
+			Path:         *logFile,
+			MaxSizeBytes: *logMaxSizeMB * 1024 * 1024,
+			MaxAge:       time.Duration(*logMaxAgeHours) * time.Hour,
+			MaxBackups:   *logMaxBackups,
+			Compress:     *logCompress,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		logWriter = rotatingLogWriter
+	}
 
 	if *logToSyslog {
 		syslogWriter, err := syslog.New(syslog.LOG_INFO, "gofileserver")
@@ -47,25 +92,92 @@ func main() {
 	}
 
 	logger := httploghandler.NewW3CFormatWriter(logWriter)
+
+	format, err := httploghandler.ParseFormat(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var formatOpt httploghandler.Option
+	switch format {
+	case httploghandler.LogFormatJSON:
+		formatOpt = httploghandler.WithWriter(logWriter, httploghandler.LogFormatJSON)
+	case httploghandler.LogFormatLogfmt:
+		formatOpt = httploghandler.WithWriter(logWriter, httploghandler.LogFormatLogfmt)
+	case httploghandler.LogFormatLokiPush:
+		labels, err := httploghandler.ParseLabels(*lokiLabels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		formatOpt = httploghandler.WithLokiConfig(httploghandler.LokiConfig{
+			PushURL:       *lokiPushURL,
+			TenantID:      *lokiTenantID,
+			Labels:        labels,
+			BatchSize:     *lokiBatchSize,
+			FlushInterval: *lokiFlushInterval,
+			QueueSize:     *lokiQueueSize,
+		})
+	default:
+		formatOpt = httploghandler.WithW3CFormatWriter(logger)
+	}
+
+	timeoutHandler := httptimeout.NewHandler(
+		newBetterHttpListingServer(http.Dir(*rootDirectory)),
+		httptimeout.Limits{
+			MinWriteBytesPerSec: *minWriteBytesPerSec,
+			WriteIdleTimeout:    *writeIdleTimeout,
+			MaxRequestDuration:  *maxRequestDuration,
+		})
 	var wg sync.WaitGroup
 	logHandler, err := httploghandler.NewHandler(
-		newBetterHttpListingServer(http.Dir(*rootDirectory)), httploghandler.LogFormatExtendedLegacy,
-		httploghandler.WithW3CFormatWriter(logger), httploghandler.WithWaitGroup(&wg))
+		timeoutHandler, format, formatOpt, httploghandler.WithWaitGroup(&wg))
 	if err != nil {
 		logger.WriteComment(fmt.Sprintf("Error initializing logging: %v", err))
 		return
 	}
+	if rotatingLogWriter != nil {
+		rotatingLogWriter.OnRotate = logHandler.WriteFileHeader
+	}
+
+	if *StateDBPath != "" {
+		store, err := statestore.Open(*StateDBPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+		http.Handle("/api/state/ws", newStateWSHandler(store))
+	}
+
 	http.Handle("/", logHandler)
 
 	server := &http.Server{
 		Addr: *bindAddress,
 	}
 
+	proxyMode, err := proxyproto.ParseMode(*proxyProtocolMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", *bindAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if proxyMode != proxyproto.Off {
+		trustedCIDRs, err := proxyproto.ParseTrustedCIDRs(*trustedProxyCIDRs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listener = &proxyproto.Listener{
+			Listener:     listener,
+			Mode:         proxyMode,
+			TrustedCIDRs: trustedCIDRs,
+		}
+	}
+
 	wg.Add(1)
 	go func() {
 		defer cancel()
 		defer wg.Done()
-		err := server.ListenAndServe()
+		err := server.Serve(listener)
 		if err != nil && err != http.ErrServerClosed {
 			logger.WriteComment("Error: " + err.Error())
 		}
@@ -87,6 +199,18 @@ func main() {
 		<-sigC
 	}()
 
+	if rotatingLogWriter != nil {
+		go func() {
+			hupC := make(chan os.Signal, 1)
+			signal.Notify(hupC, syscall.SIGHUP)
+			for range hupC {
+				if err := rotatingLogWriter.Rotate(); err != nil {
+					logger.WriteComment("Error rotating log: " + err.Error())
+				}
+			}
+		}()
+	}
+
 	<-ctx.Done()
 	logger.WriteComment("Status: Shutting down")
 	server.Close()
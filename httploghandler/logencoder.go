@@ -0,0 +1,55 @@
+package httploghandler
+
+import "time"
+
+// Record is the structured representation of a single access log entry (or
+// provisional marker), independent of the wire format it will be encoded
+// into.
+type Record struct {
+	Timestamp   time.Time
+	RemoteAddr  string
+	Method      string
+	URI         string
+	Protocol    string
+	UserAgent   string
+	Range       string
+	Status      int
+	Bytes       int64
+	DurationSec float64
+	WriteError  string
+	RequestID   int64
+
+	// ContentRange is the Content-Range response header, present when the
+	// request was served as partial content. BodyBytes counts only the
+	// response body, unlike Bytes which may include raw header bytes
+	// written directly to a hijacked connection. RangeSatisfied is one
+	// of "", "true" or "false", depending on whether a Range request was
+	// made and whether it was honored.
+	ContentRange   string
+	BodyBytes      int64
+	RangeSatisfied string
+
+	// Provisional is true for the early marker written while a slow
+	// request is still being handled, as opposed to the final record
+	// written once it completes.
+	Provisional bool
+	// AsyncAssoc links a provisional record to its eventual final record
+	// (or vice versa). It is one of "", "->" or "<-".
+	AsyncAssoc string
+}
+
+// HeaderMeta carries the information traditionally emitted once at the start
+// of a W3C extended log file. Encoders that have no notion of a file header
+// (e.g. one JSON object per request) are free to ignore it.
+type HeaderMeta struct {
+	Version string
+	Date    time.Time
+	Fields  string
+}
+
+// LogEncoder serializes Records (and an optional file header) to some
+// underlying transport. Implementations must be safe for concurrent use.
+type LogEncoder interface {
+	WriteHeader(meta HeaderMeta) error
+	WriteRecord(rec Record) error
+}
@@ -0,0 +1,203 @@
+package httploghandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// LokiConfig configures the Loki push encoder.
+type LokiConfig struct {
+	// PushURL is the full Loki push endpoint, e.g.
+	// http://loki:3100/loki/api/v1/push.
+	PushURL string
+	// TenantID, if non-empty, is sent as the X-Scope-OrgID header.
+	TenantID string
+	// Labels are attached to every stream pushed by this encoder.
+	Labels map[string]string
+
+	// BatchSize is the number of records buffered before a push is
+	// triggered. Defaults to 100 if zero.
+	BatchSize int
+	// FlushInterval is the maximum time a record can sit in the queue
+	// before being pushed, even if BatchSize hasn't been reached.
+	// Defaults to 5s if zero.
+	FlushInterval time.Duration
+	// QueueSize bounds the number of records held in memory; once full,
+	// new records are dropped rather than blocking the request path.
+	// Defaults to 10000 if zero.
+	QueueSize int
+	// MaxRetries bounds the number of retry attempts per batch.
+	// Defaults to 5 if zero.
+	MaxRetries int
+
+	// Client is the http.Client used to push batches. http.DefaultClient
+	// is used if nil.
+	Client *http.Client
+}
+
+func (c LokiConfig) withDefaults() LokiConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 5 * time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 10000
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 5
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	return c
+}
+
+// lokiEncoder batches records in memory and ships them to a Loki
+// /loki/api/v1/push endpoint on a background goroutine.
+type lokiEncoder struct {
+	config LokiConfig
+
+	queue chan Record
+	done  chan struct{}
+}
+
+func newLokiEncoder(config LokiConfig) *lokiEncoder {
+	config = config.withDefaults()
+	e := &lokiEncoder{
+		config: config,
+		queue:  make(chan Record, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *lokiEncoder) WriteHeader(meta HeaderMeta) error {
+	return nil
+}
+
+func (e *lokiEncoder) WriteRecord(rec Record) error {
+	select {
+	case e.queue <- rec:
+		return nil
+	default:
+		return fmt.Errorf("httploghandler: loki queue full, dropping record")
+	}
+}
+
+func (e *lokiEncoder) run() {
+	defer close(e.done)
+	batch := make([]Record, 0, e.config.BatchSize)
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.push(batch); err != nil {
+			log.Printf("httploghandler: failed to push logs to loki: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case rec, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= e.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (e *lokiEncoder) push(batch []Record) error {
+	values := make([][2]string, len(batch))
+	for i, rec := range batch {
+		line, err := json.Marshal(toJSONRecord(rec))
+		if err != nil {
+			return err
+		}
+		values[i] = [2]string{fmt.Sprintf("%d", rec.Timestamp.UnixNano()), string(line)}
+	}
+
+	body, err := json.Marshal(lokiPushRequest{
+		Streams: []lokiStream{{Stream: e.config.Labels, Values: values}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= e.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoffDuration(attempt))
+		}
+		lastErr = e.pushOnce(body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("httploghandler: giving up pushing to loki after %d attempts: %w", e.config.MaxRetries+1, lastErr)
+}
+
+func (e *lokiEncoder) pushOnce(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.config.PushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", e.config.TenantID)
+	}
+
+	resp, err := e.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("loki push returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func backoffDuration(attempt int) time.Duration {
+	d := 100 * time.Millisecond
+	for i := 0; i < attempt; i++ {
+		d *= 2
+	}
+	if d > 10*time.Second {
+		d = 10 * time.Second
+	}
+	return d
+}
+
+// Close stops accepting new records, flushes the remaining queue, and waits
+// for the background pusher to exit.
+func (e *lokiEncoder) Close() {
+	close(e.queue)
+	<-e.done
+}
@@ -0,0 +1,120 @@
+package httploghandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// jsonRecord is the wire shape for LogFormatJSON, one object per line.
+type jsonRecord struct {
+	Timestamp   string  `json:"timestamp"`
+	RemoteAddr  string  `json:"remote_addr"`
+	Method      string  `json:"method"`
+	URI         string  `json:"uri"`
+	Protocol    string  `json:"protocol"`
+	UserAgent   string  `json:"user_agent"`
+	Range       string  `json:"range"`
+	Status      int     `json:"status,omitempty"`
+	Bytes       int64   `json:"bytes,omitempty"`
+	DurationSec float64 `json:"duration_sec,omitempty"`
+	WriteError  string  `json:"write_error,omitempty"`
+	RequestID   int64   `json:"request_id"`
+	AsyncAssoc  string  `json:"async_assoc,omitempty"`
+	Provisional bool    `json:"provisional,omitempty"`
+
+	ContentRange   string `json:"content_range,omitempty"`
+	BodyBytes      int64  `json:"body_bytes,omitempty"`
+	RangeSatisfied string `json:"range_satisfied,omitempty"`
+}
+
+func toJSONRecord(rec Record) jsonRecord {
+	return jsonRecord{
+		Timestamp:   rec.Timestamp.Format(w3cDate + "T" + w3cTime + "Z07:00"),
+		RemoteAddr:  rec.RemoteAddr,
+		Method:      rec.Method,
+		URI:         rec.URI,
+		Protocol:    rec.Protocol,
+		UserAgent:   rec.UserAgent,
+		Range:       rec.Range,
+		Status:      rec.Status,
+		Bytes:       rec.Bytes,
+		DurationSec: rec.DurationSec,
+		WriteError:  rec.WriteError,
+		RequestID:   rec.RequestID,
+		AsyncAssoc:  rec.AsyncAssoc,
+		Provisional: rec.Provisional,
+
+		ContentRange:   rec.ContentRange,
+		BodyBytes:      rec.BodyBytes,
+		RangeSatisfied: rec.RangeSatisfied,
+	}
+}
+
+// jsonEncoder writes one JSON object per record, newline-delimited.
+type jsonEncoder struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func newJSONEncoder(w io.Writer) *jsonEncoder {
+	return &jsonEncoder{writer: w}
+}
+
+func (e *jsonEncoder) WriteHeader(meta HeaderMeta) error {
+	return nil
+}
+
+func (e *jsonEncoder) WriteRecord(rec Record) error {
+	b, err := json.Marshal(toJSONRecord(rec))
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.writer.Write(append(b, '\n'))
+	return err
+}
+
+// logfmtEncoder writes records as space-separated key=value pairs, quoting
+// values that contain whitespace.
+type logfmtEncoder struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func newLogfmtEncoder(w io.Writer) *logfmtEncoder {
+	return &logfmtEncoder{writer: w}
+}
+
+func (e *logfmtEncoder) WriteHeader(meta HeaderMeta) error {
+	return nil
+}
+
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+		return strconvQuote(v)
+	}
+	return v
+}
+
+func strconvQuote(v string) string {
+	return fmt.Sprintf("%q", v)
+}
+
+func (e *logfmtEncoder) WriteRecord(rec Record) error {
+	jr := toJSONRecord(rec)
+	line := fmt.Sprintf(
+		"timestamp=%s remote_addr=%s method=%s uri=%s protocol=%s user_agent=%s range=%s status=%d bytes=%d duration_sec=%f write_error=%s request_id=%d async_assoc=%s provisional=%t content_range=%s body_bytes=%d range_satisfied=%s\n",
+		logfmtValue(jr.Timestamp), logfmtValue(jr.RemoteAddr), logfmtValue(jr.Method), logfmtValue(jr.URI),
+		logfmtValue(jr.Protocol), logfmtValue(jr.UserAgent), logfmtValue(jr.Range), jr.Status, jr.Bytes,
+		jr.DurationSec, logfmtValue(jr.WriteError), jr.RequestID, logfmtValue(jr.AsyncAssoc), jr.Provisional,
+		logfmtValue(jr.ContentRange), jr.BodyBytes, logfmtValue(jr.RangeSatisfied),
+	)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err := io.WriteString(e.writer, line)
+	return err
+}
@@ -0,0 +1,94 @@
+package httploghandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord() Record {
+	return Record{
+		Timestamp:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		RemoteAddr: "127.0.0.1:1234",
+		Method:     "GET",
+		URI:        "/a file.txt",
+		Protocol:   "HTTP/1.1",
+		Status:     200,
+		Bytes:      42,
+		RequestID:  7,
+	}
+}
+
+func TestJSONEncoderWriteRecordRoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	e := newJSONEncoder(&buf)
+	if err := e.WriteRecord(testRecord()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got jsonRecord
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't valid JSON: %v (%q)", err, buf.String())
+	}
+	if got.URI != "/a file.txt" || got.Status != 200 || got.RequestID != 7 {
+		t.Fatalf("unexpected decoded record: %+v", got)
+	}
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Fatal("WriteRecord must newline-delimit records")
+	}
+}
+
+func TestLogfmtEncoderQuotesValuesWithSpaces(t *testing.T) {
+	var buf bytes.Buffer
+	e := newLogfmtEncoder(&buf)
+	if err := e.WriteRecord(testRecord()); err != nil {
+		t.Fatal(err)
+	}
+
+	line := buf.String()
+	if !strings.Contains(line, `uri="/a file.txt"`) {
+		t.Fatalf("expected uri value to be quoted, got: %q", line)
+	}
+	if !strings.Contains(line, "status=200") {
+		t.Fatalf("expected unquoted numeric field, got: %q", line)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	cases := map[string]LogFormat{
+		"":               LogFormatExtendedLegacy,
+		"extended_legacy": LogFormatExtendedLegacy,
+		"json":           LogFormatJSON,
+		"logfmt":         LogFormatLogfmt,
+		"loki":           LogFormatLokiPush,
+	}
+	for s, want := range cases {
+		got, err := ParseFormat(s)
+		if err != nil {
+			t.Fatalf("ParseFormat(%q) returned error: %v", s, err)
+		}
+		if got != want {
+			t.Fatalf("ParseFormat(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if _, err := ParseFormat("bogus"); err == nil {
+		t.Fatal("ParseFormat(\"bogus\") should have returned an error")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	got, err := ParseLabels("job=gofileserver, env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"job": "gofileserver", "env": "prod"}
+	if len(got) != len(want) || got["job"] != want["job"] || got["env"] != want["env"] {
+		t.Fatalf("ParseLabels = %v, want %v", got, want)
+	}
+
+	if _, err := ParseLabels("invalid"); err == nil {
+		t.Fatal("ParseLabels(\"invalid\") should have returned an error")
+	}
+}
@@ -0,0 +1,49 @@
+package httploghandler
+
+import "fmt"
+
+// w3cEncoder adapts a *W3CFormatWriter, which only knows how to write rows of
+// CSV-ish fields, to the LogEncoder interface.
+type w3cEncoder struct {
+	writer *W3CFormatWriter
+}
+
+func newW3CEncoder(w *W3CFormatWriter) *w3cEncoder {
+	return &w3cEncoder{writer: w}
+}
+
+func (e *w3cEncoder) WriteHeader(meta HeaderMeta) error {
+	e.writer.WriteComment(fmt.Sprintf("Version: %s", meta.Version))
+	e.writer.WriteComment(fmt.Sprintf("Date: %s %s", meta.Date.Format(w3cDate), meta.Date.Format(w3cTime)))
+	e.writer.WriteComment(meta.Fields)
+	return nil
+}
+
+func (e *w3cEncoder) WriteRecord(rec Record) error {
+	fields := []string{
+		rec.Timestamp.Format(w3cDate), rec.Timestamp.Format(w3cTime), rec.RemoteAddr, rec.Method, rec.URI,
+		rec.Protocol, rec.UserAgent, rec.Range,
+	}
+	if rec.Provisional {
+		fields = append(fields, "->", fmt.Sprintf("0x%08x", rec.RequestID))
+		e.writer.WriteCommented(fields)
+		return nil
+	}
+
+	fields = append(fields,
+		fmt.Sprintf("%d", rec.Status),
+		fmt.Sprintf("%d", rec.Bytes),
+		fmt.Sprintf("%f", rec.DurationSec),
+		rec.WriteError,
+		rec.ContentRange,
+		fmt.Sprintf("%d", rec.BodyBytes),
+		rec.RangeSatisfied,
+	)
+	if rec.AsyncAssoc == "<-" {
+		fields = append(fields, fmt.Sprintf("<- 0x%08x", rec.RequestID))
+	} else {
+		fields = append(fields, "")
+	}
+	e.writer.Write(fields)
+	return nil
+}
@@ -2,7 +2,6 @@ package httploghandler
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -17,7 +16,7 @@ const w3cTime = "15:04:05"
 type w3cLogger struct {
 	Writer http.ResponseWriter
 
-	LogWriter *W3CFormatWriter
+	Encoder   LogEncoder
 	WaitGroup *sync.WaitGroup
 
 	RequestId  int64
@@ -34,7 +33,17 @@ type w3cLogger struct {
 	Written    int64
 	WriteError error
 
-	started time.Time
+	// ContentRange and RangeSatisfied are populated from the response
+	// headers once WriteHeader is called, to support range-aware
+	// logging. BodyBytes counts only bytes written through Write, as
+	// opposed to Written which (for hijacked connections) also includes
+	// raw header bytes written directly to the wire.
+	ContentRange   string
+	RangeSatisfied string
+	BodyBytes      int64
+
+	started     time.Time
+	headersSent bool
 
 	partialLogTimer *time.Timer
 	onceAfterHandle sync.Once
@@ -49,9 +58,22 @@ func (w *w3cLogger) Header() http.Header {
 	return w.Writer.Header()
 }
 
+// Unwrap exposes the wrapped ResponseWriter to http.ResponseController, so
+// callers (e.g. httptimeout) can reach optional interfaces like
+// SetWriteDeadline on the real net/http response without having to Hijack
+// through this logger.
+func (w *w3cLogger) Unwrap() http.ResponseWriter {
+	return w.Writer
+}
+
 func (w *w3cLogger) Write(b []byte) (int, error) {
+	if !w.headersSent {
+		w.captureRangeInfo()
+		w.headersSent = true
+	}
 	n, err := w.Writer.Write(b)
 	w.Written += int64(n)
+	w.BodyBytes += int64(n)
 	if err != nil {
 		w.WriteError = err
 	}
@@ -60,14 +82,36 @@ func (w *w3cLogger) Write(b []byte) (int, error) {
 
 func (w *w3cLogger) WriteHeader(status int) {
 	w.Status = status
+	w.captureRangeInfo()
+	w.headersSent = true
 	w.Writer.WriteHeader(status)
 }
 
-func (w *w3cLogger) MakePrefixFields() []string {
-	t := time.Now()
-	return []string{
-		t.Format(w3cDate), t.Format(w3cTime), w.RemoteAddr, w.Method, w.URI,
-		w.Protocol, w.UserAgent, w.Range,
+// captureRangeInfo records whether the current Range request was honored,
+// based on the response status and headers set so far. It is idempotent so
+// it can be called from both WriteHeader and an implicit-200 first Write.
+func (w *w3cLogger) captureRangeInfo() {
+	switch {
+	case w.Status == http.StatusPartialContent:
+		w.RangeSatisfied = "true"
+		w.ContentRange = w.Writer.Header().Get("Content-Range")
+	case w.Status == http.StatusRequestedRangeNotSatisfiable:
+		w.RangeSatisfied = "false"
+	case w.Range != "" && w.Status == http.StatusOK:
+		w.RangeSatisfied = "false"
+	}
+}
+
+func (w *w3cLogger) MakeRecord() Record {
+	return Record{
+		Timestamp:  time.Now(),
+		RemoteAddr: w.RemoteAddr,
+		Method:     w.Method,
+		URI:        w.URI,
+		Protocol:   w.Protocol,
+		UserAgent:  w.UserAgent,
+		Range:      w.Range,
+		RequestID:  w.RequestId,
 	}
 }
 
@@ -76,28 +120,30 @@ func (w *w3cLogger) OnBeforeHandle() {
 	w.partialLogTimer = time.AfterFunc(w.ProvisionalLogDelay,
 		func() {
 			defer w.WaitGroup.Done()
-			w.LogWriter.WriteCommented(append(w.MakePrefixFields(), "->", fmt.Sprintf("0x%08x", w.RequestId)))
+			rec := w.MakeRecord()
+			rec.Provisional = true
+			rec.AsyncAssoc = "->"
+			w.Encoder.WriteRecord(rec)
 		})
 }
 
 func (w *w3cLogger) OnAfterHandle() {
-	suffix := []string{
-		fmt.Sprintf("%d", w.Status),
-		fmt.Sprintf("%d", w.Written),
-		fmt.Sprintf("%f", time.Now().Sub(w.started).Seconds()),
-	}
+	rec := w.MakeRecord()
+	rec.Status = w.Status
+	rec.Bytes = w.Written
+	rec.BodyBytes = w.BodyBytes
+	rec.ContentRange = w.ContentRange
+	rec.RangeSatisfied = w.RangeSatisfied
+	rec.DurationSec = time.Now().Sub(w.started).Seconds()
 	if w.WriteError != nil {
-		suffix = append(suffix, w.WriteError.Error())
-	} else {
-		suffix = append(suffix, "")
+		rec.WriteError = w.WriteError.Error()
 	}
 	if !w.partialLogTimer.Stop() {
-		suffix = append(suffix, fmt.Sprintf("<- 0x%08x", w.RequestId))
+		rec.AsyncAssoc = "<-"
 	} else {
-		suffix = append(suffix, "")
 		w.WaitGroup.Done()
 	}
-	w.LogWriter.Write(append(w.MakePrefixFields(), suffix...))
+	w.Encoder.WriteRecord(rec)
 }
 
 type w3cHijackerLogger struct {
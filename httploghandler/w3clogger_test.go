@@ -0,0 +1,61 @@
+package httploghandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaptureRangeInfoPartialContent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &w3cLogger{Writer: rec, Range: "bytes=0-99"}
+	w.Init()
+
+	rec.Header().Set("Content-Range", "bytes 0-99/1000")
+	w.WriteHeader(http.StatusPartialContent)
+
+	if w.RangeSatisfied != "true" {
+		t.Fatalf("RangeSatisfied = %q, want true", w.RangeSatisfied)
+	}
+	if w.ContentRange != "bytes 0-99/1000" {
+		t.Fatalf("ContentRange = %q, want the Content-Range header value", w.ContentRange)
+	}
+}
+
+func TestCaptureRangeInfoNotSatisfiable(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &w3cLogger{Writer: rec, Range: "bytes=9999-"}
+	w.Init()
+
+	w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+
+	if w.RangeSatisfied != "false" {
+		t.Fatalf("RangeSatisfied = %q, want false", w.RangeSatisfied)
+	}
+}
+
+func TestCaptureRangeInfoIgnoredWhenNoRangeRequested(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &w3cLogger{Writer: rec}
+	w.Init()
+
+	w.WriteHeader(http.StatusOK)
+
+	if w.RangeSatisfied != "" {
+		t.Fatalf("RangeSatisfied = %q, want empty when no Range header was sent", w.RangeSatisfied)
+	}
+}
+
+func TestWriteCountsBodyBytes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &w3cLogger{Writer: rec}
+	w.Init()
+
+	n, err := w.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || w.BodyBytes != 5 || w.Written != 5 {
+		t.Fatalf("n=%d BodyBytes=%d Written=%d, want all 5", n, w.BodyBytes, w.Written)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,26 +16,77 @@ import (
 type LogFormat int
 
 const (
+	// LogFormatExtendedLegacy is the original W3C extended log format
+	// written to a *W3CFormatWriter. It remains the default.
 	LogFormatExtendedLegacy LogFormat = iota
+	// LogFormatJSON writes one JSON object per record, newline-delimited.
+	LogFormatJSON
+	// LogFormatLogfmt writes records as space-separated key=value pairs.
+	LogFormatLogfmt
+	// LogFormatLokiPush batches records and pushes them to a Grafana Loki
+	// instance's push API.
+	LogFormatLokiPush
 )
 
+// ParseFormat parses the --log_format flag value into a LogFormat.
+func ParseFormat(s string) (LogFormat, error) {
+	switch s {
+	case "extended_legacy", "":
+		return LogFormatExtendedLegacy, nil
+	case "json":
+		return LogFormatJSON, nil
+	case "logfmt":
+		return LogFormatLogfmt, nil
+	case "loki":
+		return LogFormatLokiPush, nil
+	default:
+		return 0, fmt.Errorf("httploghandler: unknown log format %q (want extended_legacy, json, logfmt, or loki)", s)
+	}
+}
+
+// ParseLabels parses the comma-separated --loki_labels flag value (e.g.
+// "job=gofileserver,env=prod") into the map LokiConfig.Labels expects. An
+// empty string yields a nil map.
+func ParseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("httploghandler: invalid label %q (want key=value)", part)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
 type Option func(h *Handler) error
 
 type Handler struct {
-	handler   http.Handler
-	logWriter *W3CFormatWriter
+	handler http.Handler
+	encoder LogEncoder
 
 	wg                  *sync.WaitGroup
 	provisionalLogDelay time.Duration
 
 	requestCounter *int64
+
+	// encoderFormat and encoderFormatSet record which LogFormat the
+	// selected With* option actually configured, so NewHandler can check
+	// it against the requested format instead of letting format be
+	// purely decorative. WithLogEncoder leaves encoderFormatSet false,
+	// since a caller-provided encoder isn't tied to any one LogFormat.
+	encoderFormat    LogFormat
+	encoderFormatSet bool
 }
 
 func NewHandler(handler http.Handler, format LogFormat, opts ...Option) (*Handler, error) {
-	if format != LogFormatExtendedLegacy {
-		return nil, errors.New("unsupported log format")
-	}
-
 	h := &Handler{
 		handler:             handler,
 		wg:                  new(sync.WaitGroup),
@@ -48,8 +100,16 @@ func NewHandler(handler http.Handler, format LogFormat, opts ...Option) (*Handle
 		}
 	}
 
-	if h.logWriter == nil {
-		return nil, errors.New("a log writer must be specified")
+	if h.encoder == nil {
+		return nil, errors.New("a log encoder (or a format-specific writer) must be specified")
+	}
+	switch format {
+	case LogFormatExtendedLegacy, LogFormatJSON, LogFormatLogfmt, LogFormatLokiPush:
+	default:
+		return nil, errors.New("unsupported log format")
+	}
+	if h.encoderFormatSet && h.encoderFormat != format {
+		return nil, fmt.Errorf("log format %d requested, but the supplied option configured an encoder for format %d", format, h.encoderFormat)
 	}
 	return h, nil
 }
@@ -59,11 +119,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer h.wg.Done()
 	requestId := atomic.AddInt64(h.requestCounter, 1)
 	if requestId == 1 {
-		h.writeFileHeader()
+		h.WriteFileHeader()
 	}
 	rww := &w3cLogger{
-		Writer:    w,
-		LogWriter: h.logWriter,
+		Writer:  w,
+		Encoder: h.encoder,
+
 		WaitGroup: h.wg,
 
 		RequestId:  requestId,
@@ -78,24 +139,88 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	rww.Init()
 	rww.OnBeforeHandle()
-	defer rww.OnAfterHandle()
-	h.handler.ServeHTTP(rww, r)
-}
 
-func (h *Handler) writeFileHeader() {
-	h.logWriter.WriteComment("Version: 1.0")
-	h.logWriter.WriteComment(fmt.Sprintf("Date: %s %s", time.Now().Format(w3cDate), time.Now().Format(w3cTime)))
-	h.logWriter.WriteComment("Fields: date time c-ip cs-method cs-uri x-cs-protocol cs(User-Agent) cs(Range) sc-status bytes time-taken x-write-error x-async-association")
+	// If the underlying ResponseWriter supports hijacking (as the
+	// standard library's does), forward that capability through a
+	// w3cHijackerLogger so wrapped handlers can still hijack the
+	// connection. Logging then
+	// completes when the hijacked connection is closed rather than when
+	// the handler returns.
+	var logged http.ResponseWriter = rww
+	onAfterHandle := rww.OnAfterHandle
+	if hj, ok := w.(http.Hijacker); ok {
+		hjw := &w3cHijackerLogger{w3cLogger: rww, Hijacker: hj}
+		logged = hjw
+		onAfterHandle = hjw.OnAfterHandle
+	}
+	defer onAfterHandle()
+	h.handler.ServeHTTP(logged, r)
+}
 
+// WriteFileHeader emits a fresh file header to the underlying encoder. It is
+// called automatically on the first request, and can be called again by a
+// rotating log writer (see logrotate.Writer.OnRotate) after rollover.
+func (h *Handler) WriteFileHeader() {
+	h.encoder.WriteHeader(HeaderMeta{
+		Version: "1.2",
+		Date:    time.Now(),
+		Fields:  "Fields: date time c-ip cs-method cs-uri x-cs-protocol cs(User-Agent) cs(Range) sc-status bytes time-taken x-write-error sc-content-range sc-bytes-body x-range-satisfied x-async-association",
+	})
 }
 
+// WithLogWriter is a convenience wrapper that wraps w in a *W3CFormatWriter
+// and selects it as the log encoder, for use with LogFormatExtendedLegacy.
 func WithLogWriter(w io.Writer) Option {
 	return WithW3CFormatWriter(NewW3CFormatWriter(w))
 }
 
+// WithW3CFormatWriter selects w as the destination for LogFormatExtendedLegacy.
 func WithW3CFormatWriter(w *W3CFormatWriter) Option {
 	return func(h *Handler) error {
-		h.logWriter = w
+		h.encoder = newW3CEncoder(w)
+		h.encoderFormat = LogFormatExtendedLegacy
+		h.encoderFormatSet = true
+		return nil
+	}
+}
+
+// WithWriter selects w as the destination for LogFormatJSON or LogFormatLogfmt.
+// The format argument decides which encoding is used; NewHandler returns an
+// error if it differs from the format passed to NewHandler.
+func WithWriter(w io.Writer, format LogFormat) Option {
+	return func(h *Handler) error {
+		switch format {
+		case LogFormatJSON:
+			h.encoder = newJSONEncoder(w)
+		case LogFormatLogfmt:
+			h.encoder = newLogfmtEncoder(w)
+		default:
+			return errors.New("WithWriter only supports LogFormatJSON and LogFormatLogfmt")
+		}
+		h.encoderFormat = format
+		h.encoderFormatSet = true
+		return nil
+	}
+}
+
+// WithLokiConfig selects a Loki push encoder for LogFormatLokiPush.
+func WithLokiConfig(config LokiConfig) Option {
+	return func(h *Handler) error {
+		if config.PushURL == "" {
+			return errors.New("WithLokiConfig requires a PushURL")
+		}
+		h.encoder = newLokiEncoder(config)
+		h.encoderFormat = LogFormatLokiPush
+		h.encoderFormatSet = true
+		return nil
+	}
+}
+
+// WithLogEncoder selects a caller-provided LogEncoder, bypassing the
+// format-specific defaults above.
+func WithLogEncoder(e LogEncoder) Option {
+	return func(h *Handler) error {
+		h.encoder = e
 		return nil
 	}
 }
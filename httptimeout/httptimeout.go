@@ -0,0 +1,152 @@
+// Package httptimeout evicts slow clients from streaming responses.
+//
+// The standard library's http.Server enforces no write deadline of its own,
+// so a client that stops reading (deliberately or otherwise) can pin a
+// goroutine and an open file descriptor for as long as it likes. Handler
+// enforces a minimum write throughput and an idle/absolute duration bound by
+// setting an already-past write deadline on the underlying connection once a
+// limit is crossed.
+package httptimeout
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits configures the thresholds enforced by Handler. A zero value in any
+// field disables that particular check.
+type Limits struct {
+	// MinWriteBytesPerSec is the minimum average throughput, measured
+	// since the first byte was written, that a connection must sustain.
+	MinWriteBytesPerSec int64
+	// WriteIdleTimeout is the maximum time allowed to elapse between two
+	// successive calls to Write.
+	WriteIdleTimeout time.Duration
+	// MaxRequestDuration bounds the total lifetime of a request.
+	MaxRequestDuration time.Duration
+}
+
+// Handler wraps an inner http.Handler, evicting clients whose connection
+// fails to keep up with Limits.
+type Handler struct {
+	handler http.Handler
+	limits  Limits
+}
+
+func NewHandler(handler http.Handler, limits Limits) *Handler {
+	return &Handler{handler: handler, limits: limits}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gw := &guardedWriter{
+		ResponseWriter: w,
+		limits:         h.limits,
+	}
+	defer gw.stop()
+
+	if h.limits.MaxRequestDuration > 0 {
+		gw.durationTimer = time.AfterFunc(h.limits.MaxRequestDuration, func() {
+			gw.evict()
+		})
+	}
+
+	h.handler.ServeHTTP(gw, r)
+}
+
+// guardedWriter wraps a http.ResponseWriter, tracking write progress and
+// evicting the underlying connection when it falls outside of Limits.
+//
+// Eviction sets a write deadline in the past on the underlying net.Conn via
+// http.ResponseController (see evict), rather than hijacking it: a blocked
+// Write can be happening concurrently on the handler's goroutine at the
+// exact moment eviction fires, and net/http's Hijack races with an in-flight
+// Write on the same connection (they share unsynchronized access to the
+// response's buffered writer). SetWriteDeadline has no such restriction and
+// is documented safe to call from another goroutine while a write is in
+// progress. The resulting write error flows back up through the normal
+// ResponseWriter.Write chain and ends up recorded in the access log's
+// x-write-error field, so no further coupling to the logger is required.
+type guardedWriter struct {
+	http.ResponseWriter
+	limits Limits
+
+	mu      sync.Mutex
+	started time.Time
+	written int64
+	evicted bool
+
+	idleTimer     *time.Timer
+	durationTimer *time.Timer
+}
+
+// Unwrap exposes the wrapped ResponseWriter to http.ResponseController.
+func (w *guardedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *guardedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+	w.mu.Unlock()
+
+	n, err := w.ResponseWriter.Write(b)
+
+	w.mu.Lock()
+	w.written += int64(n)
+	elapsed := time.Since(w.started)
+	w.resetIdleTimerLocked()
+	w.mu.Unlock()
+
+	if w.limits.MinWriteBytesPerSec > 0 && elapsed > time.Second {
+		required := float64(w.limits.MinWriteBytesPerSec) * elapsed.Seconds()
+		if float64(w.written) < required {
+			w.evict()
+		}
+	}
+
+	return n, err
+}
+
+func (w *guardedWriter) resetIdleTimerLocked() {
+	if w.limits.WriteIdleTimeout <= 0 {
+		return
+	}
+	if w.idleTimer == nil {
+		w.idleTimer = time.AfterFunc(w.limits.WriteIdleTimeout, func() {
+			w.evict()
+		})
+		return
+	}
+	w.idleTimer.Reset(w.limits.WriteIdleTimeout)
+}
+
+func (w *guardedWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.idleTimer != nil {
+		w.idleTimer.Stop()
+	}
+	if w.durationTimer != nil {
+		w.durationTimer.Stop()
+	}
+}
+
+// evict aborts the connection underlying w by setting an already-past write
+// deadline on it, so any write in progress (or yet to start) fails
+// immediately. The resulting error surfaces to the caller through the
+// normal Write path; net/http tears down the connection once the handler
+// returns with a failed write.
+func (w *guardedWriter) evict() {
+	w.mu.Lock()
+	if w.evicted {
+		w.mu.Unlock()
+		return
+	}
+	w.evicted = true
+	w.mu.Unlock()
+
+	http.NewResponseController(w.ResponseWriter).SetWriteDeadline(time.Now())
+}
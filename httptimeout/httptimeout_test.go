@@ -0,0 +1,96 @@
+package httptimeout
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// deadlineWriter is a http.ResponseWriter that also implements the optional
+// SetWriteDeadline interface http.ResponseController looks for, recording
+// every deadline it's given.
+type deadlineWriter struct {
+	http.ResponseWriter
+	deadlines chan time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(t time.Time) error {
+	w.deadlines <- t
+	return nil
+}
+
+func TestEvictSetsAPastWriteDeadline(t *testing.T) {
+	dw := &deadlineWriter{ResponseWriter: httptest.NewRecorder(), deadlines: make(chan time.Time, 1)}
+	gw := &guardedWriter{ResponseWriter: dw}
+
+	gw.evict()
+
+	select {
+	case deadline := <-dw.deadlines:
+		if deadline.After(time.Now()) {
+			t.Fatalf("evict set a future deadline %v, want one in the past", deadline)
+		}
+	default:
+		t.Fatal("evict did not set a write deadline")
+	}
+	if !gw.evicted {
+		t.Fatal("evict did not mark the writer as evicted")
+	}
+}
+
+func TestEvictNoopWithoutDeadlineSupport(t *testing.T) {
+	// httptest.NewRecorder supports neither Hijack nor SetWriteDeadline;
+	// evict must not panic when neither is available.
+	gw := &guardedWriter{ResponseWriter: httptest.NewRecorder()}
+	gw.evict()
+
+	if !gw.evicted {
+		t.Fatal("evict did not mark the writer as evicted")
+	}
+}
+
+// TestEvictionUnderConcurrentWriteDoesNotRace drives a real net/http
+// connection whose client stops reading mid-response -- the scenario this
+// package exists to handle -- and confirms eviction (on a timer goroutine)
+// doesn't race with the handler goroutine's blocked Write. Run with
+// `go test -race` to catch a regression back to hijacking from evict, which
+// raced with net/http's unsynchronized access to its buffered writer.
+func TestEvictionUnderConcurrentWriteDoesNotRace(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		buf := make([]byte, 4096)
+		for i := 0; i < 10000; i++ {
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+		}
+	}), Limits{WriteIdleTimeout: 20 * time.Millisecond})
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", srv.Listener.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read only the response headers, then stop reading entirely: the
+	// server keeps writing body bytes into a socket buffer nobody drains,
+	// eventually blocking the handler goroutine's Write while the idle
+	// timer fires eviction from a different goroutine.
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+}
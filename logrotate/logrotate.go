@@ -0,0 +1,223 @@
+// Package logrotate implements a size- and time-based rotating io.Writer
+// that also exposes Flush, so it slots into
+// httploghandler.NewW3CFormatWriter in place of a plain os.File.
+package logrotate
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config configures a Writer.
+type Config struct {
+	// Path is the active log file. Rotated segments are written
+	// alongside it as Path.<timestamp>[.gz].
+	Path string
+	// MaxSizeBytes rotates the file before the next write once it has
+	// reached this size, so a single write can carry it past the limit.
+	// Zero disables size-based rotation.
+	MaxSizeBytes int64
+	// MaxAge rotates the file once it has been open longer than this.
+	// Zero disables time-based rotation.
+	MaxAge time.Duration
+	// MaxBackups bounds the number of rotated segments kept on disk,
+	// beyond the currently active file. Zero sets no count limit; segments
+	// older than MaxAge are still removed when MaxAge is set.
+	MaxBackups int
+	// Compress gzips rotated segments in the background after rollover.
+	Compress bool
+}
+
+// Writer is a rotating io.Writer. It is safe for concurrent use.
+type Writer struct {
+	config Config
+
+	// OnRotate, if set, is called right after a new log file has been
+	// opened, so callers can re-emit a fresh file header (see
+	// httploghandler.Handler.WriteFileHeader). It always runs with the
+	// Writer's mutex released, since it is expected to call back into
+	// the Writer (e.g. via Write) to emit that header.
+	OnRotate func()
+
+	mutex    sync.Mutex
+	file     *os.File
+	written  int64
+	openedAt time.Time
+}
+
+// NewWriter opens (or creates) config.Path and returns a ready Writer.
+func NewWriter(config Config) (*Writer, error) {
+	w := &Writer{config: config}
+	if err := w.openLocked(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) openLocked() error {
+	f, err := os.OpenFile(w.config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.written = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	rotated := false
+	if w.shouldRotateLocked() {
+		if err := w.rotateLocked(); err != nil {
+			w.mutex.Unlock()
+			return 0, err
+		}
+		rotated = true
+	}
+	w.mutex.Unlock()
+
+	// OnRotate re-enters this Writer (it re-emits a file header), so it
+	// must run with the mutex released; otherwise a rotation triggered
+	// from within Write would deadlock on its own lock.
+	if rotated && w.OnRotate != nil {
+		w.OnRotate()
+	}
+
+	w.mutex.Lock()
+	n, err := w.file.Write(b)
+	w.written += int64(n)
+	w.mutex.Unlock()
+	return n, err
+}
+
+func (w *Writer) shouldRotateLocked() bool {
+	if w.config.MaxSizeBytes > 0 && w.written >= w.config.MaxSizeBytes {
+		return true
+	}
+	if w.config.MaxAge > 0 && time.Since(w.openedAt) >= w.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+// Flush fsyncs the currently open file.
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.file.Sync()
+}
+
+// Rotate forces an immediate rollover, e.g. in response to SIGHUP.
+func (w *Writer) Rotate() error {
+	w.mutex.Lock()
+	err := w.rotateLocked()
+	w.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Released above for the same reason as in Write: OnRotate calls
+	// back into this Writer.
+	if w.OnRotate != nil {
+		w.OnRotate()
+	}
+	return nil
+}
+
+func (w *Writer) rotateLocked() error {
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	backupPath := w.config.Path + "." + time.Now().Format("20060102-150405")
+	if err := os.Rename(w.config.Path, backupPath); err != nil {
+		return err
+	}
+	if w.config.Compress {
+		go w.compressAndPrune(backupPath)
+	} else {
+		go w.prune()
+	}
+
+	return w.openLocked()
+}
+
+func (w *Writer) compressAndPrune(path string) {
+	if err := compressFile(path); err != nil {
+		log.Printf("logrotate: failed to compress %s: %v", path, err)
+	}
+	w.prune()
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune removes rotated segments beyond MaxBackups and/or older than MaxAge.
+func (w *Writer) prune() {
+	if w.config.MaxBackups <= 0 && w.config.MaxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.config.Path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Strings(matches) // the timestamp suffix sorts chronologically
+
+	if w.config.MaxBackups > 0 && len(matches) > w.config.MaxBackups {
+		stale := matches[:len(matches)-w.config.MaxBackups]
+		matches = matches[len(matches)-w.config.MaxBackups:]
+		for _, path := range stale {
+			os.Remove(path)
+		}
+	}
+
+	if w.config.MaxAge > 0 {
+		cutoff := time.Now().Add(-w.config.MaxAge)
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(path)
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package proxyproto implements a net.Listener wrapper that understands the
+// PROXY protocol (v1 text and v2 binary), so that r.RemoteAddr reflects the
+// real client address when gofileserver is fronted by HAProxy, nginx
+// stream, or a cloud TCP load balancer that speaks it.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Mode controls whether a PROXY protocol header is parsed, and whether its
+// absence is tolerated.
+type Mode int
+
+const (
+	// Off disables PROXY protocol parsing; connections are passed through
+	// unmodified.
+	Off Mode = iota
+	// Optional parses a PROXY protocol header when present, but also
+	// accepts connections that don't send one.
+	Optional
+	// Required rejects connections that don't start with a valid PROXY
+	// protocol header.
+	Required
+)
+
+// ParseMode parses the --proxy_protocol flag value.
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "off", "":
+		return Off, nil
+	case "optional":
+		return Optional, nil
+	case "required":
+		return Required, nil
+	default:
+		return Off, fmt.Errorf("proxyproto: unknown mode %q (want off, optional, or required)", s)
+	}
+}
+
+// ParseTrustedCIDRs parses the comma-separated --trusted_proxy_cidrs flag
+// value. An empty string yields a nil slice, which Listener treats as
+// "trust every source address".
+func ParseTrustedCIDRs(s string) ([]*net.IPNet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var cidrs []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("proxyproto: invalid trusted CIDR %q: %w", part, err)
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+	return cidrs, nil
+}
+
+// Listener wraps an inner net.Listener, rewriting the RemoteAddr of accepted
+// connections that present a PROXY protocol header. Connections from
+// sources not in TrustedCIDRs (when non-empty) are passed through
+// unexamined, since an untrusted source can't be trusted to tell the truth
+// about its header anyway.
+//
+// Connections that Accept examines for a header are returned wrapped, not as
+// *net.TCPConn, so callers that
+// hijack them later (see httploghandler's w3cLogger) naturally fall back to
+// their generic net.Conn wrapping path rather than their TCP-specific one;
+// no changes are required there.
+type Listener struct {
+	net.Listener
+	Mode         Mode
+	TrustedCIDRs []*net.IPNet
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.Mode == Off || !l.trusted(c.RemoteAddr()) {
+			return c, nil
+		}
+
+		wrapped, err := newConn(c, l.Mode)
+		if err != nil {
+			// Whatever the mode, a connection we failed to parse (or
+			// already closed below) must not be handed to the caller:
+			// close it and keep waiting for the next one.
+			c.Close()
+			continue
+		}
+		return wrapped, nil
+	}
+}
+
+func (l *Listener) trusted(addr net.Addr) bool {
+	if len(l.TrustedCIDRs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range l.TrustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// conn overrides RemoteAddr with the address recovered from a PROXY
+// protocol header, reading through reader so that any bytes already
+// buffered while probing for the header aren't lost.
+type conn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+var v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// newConn peeks at the start of inner looking for a v1 or v2 PROXY protocol
+// header, consuming it and returning a conn whose RemoteAddr reports the
+// proxied client. If no header is found, mode decides whether that's an
+// error.
+func newConn(inner net.Conn, mode Mode) (net.Conn, error) {
+	reader := bufio.NewReader(inner)
+
+	if prefix, _ := reader.Peek(6); string(prefix) == "PROXY " {
+		addr, err := parseV1(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &conn{Conn: inner, reader: reader, remoteAddr: addr}, nil
+	}
+
+	if sig, _ := reader.Peek(len(v2Signature)); bytes.Equal(sig, v2Signature) {
+		addr, local, err := parseV2(reader)
+		if err != nil {
+			return nil, err
+		}
+		if local {
+			// LOCAL: a health check from the proxy itself, sent to
+			// probe the connection rather than to proxy a client. Per
+			// spec there's no client address to recover; pass the
+			// connection through with its original address rather
+			// than failing it.
+			return &conn{Conn: inner, reader: reader, remoteAddr: inner.RemoteAddr()}, nil
+		}
+		return &conn{Conn: inner, reader: reader, remoteAddr: addr}, nil
+	}
+
+	if mode == Required {
+		return nil, errors.New("proxyproto: connection did not start with a PROXY protocol header")
+	}
+	return &conn{Conn: inner, reader: reader, remoteAddr: inner.RemoteAddr()}, nil
+}
+
+// parseV1 parses the text header "PROXY TCP4 src dst sport dport\r\n" (or
+// TCP6, or UNKNOWN), consuming it from reader.
+func parseV1(reader *bufio.Reader) (net.Addr, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Split(line, " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, errors.New("proxyproto: v1 header reports UNKNOWN source")
+	}
+	if len(fields) != 6 {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("proxyproto: invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// parseV2 parses the binary v2 header (12-byte signature already peeked by
+// the caller, version/command byte, family/proto byte, 2-byte big-endian
+// address length, then the address block), consuming it from reader. local
+// is true for a LOCAL command (e.g. a proxy's own health check), in which
+// case addr is nil and the caller should keep the connection's original
+// address rather than treating the header as an error.
+func parseV2(reader *bufio.Reader) (addr net.Addr, local bool, err error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, false, err
+	}
+	verCmd := header[12]
+	if verCmd>>4 != 2 {
+		return nil, false, fmt.Errorf("proxyproto: unsupported v2 version %d", verCmd>>4)
+	}
+	cmd := verCmd & 0x0F
+	family := header[13] >> 4
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	addrBlock := make([]byte, length)
+	if _, err := io.ReadFull(reader, addrBlock); err != nil {
+		return nil, false, err
+	}
+
+	if cmd == 0 {
+		// LOCAL: a health check from the proxy itself, not a proxied
+		// connection. There's no client address to report.
+		return nil, true, nil
+	}
+
+	switch family {
+	case 0x1: // AF_INET
+		if len(addrBlock) < 12 {
+			return nil, false, errors.New("proxyproto: short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(addrBlock[0:4]),
+			Port: int(binary.BigEndian.Uint16(addrBlock[8:10])),
+		}, false, nil
+	case 0x2: // AF_INET6
+		if len(addrBlock) < 36 {
+			return nil, false, errors.New("proxyproto: short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(addrBlock[0:16]),
+			Port: int(binary.BigEndian.Uint16(addrBlock[32:34])),
+		}, false, nil
+	default:
+		return nil, false, fmt.Errorf("proxyproto: unsupported v2 address family %d", family)
+	}
+}
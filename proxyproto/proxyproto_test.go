@@ -0,0 +1,100 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeListener hands out net.Pipe server ends one at a time, let mocking
+// connections in Accept without a real socket.
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	c, ok := <-l.conns
+	if !ok {
+		return nil, errors.New("pipeListener: closed")
+	}
+	return c, nil
+}
+
+func (l *pipeListener) Close() error { close(l.conns); return nil }
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+}
+
+func v2Header(t *testing.T, cmd byte, family byte, addrBlock []byte) []byte {
+	t.Helper()
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|cmd)
+	header = append(header, family<<4)
+	header = append(header, byte(len(addrBlock)>>8), byte(len(addrBlock)))
+	header = append(header, addrBlock...)
+	return header
+}
+
+func TestAcceptPassesThroughV2LocalCommand(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	inner := &pipeListener{conns: make(chan net.Conn, 1)}
+	inner.conns <- server
+
+	l := &Listener{Listener: inner, Mode: Optional}
+
+	go func() {
+		client.Write(v2Header(t, 0, 0, nil))
+	}()
+
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept returned an error for a LOCAL command: %v", err)
+	}
+	if accepted.RemoteAddr() != server.RemoteAddr() {
+		t.Fatalf("RemoteAddr = %v, want the original connection's address %v", accepted.RemoteAddr(), server.RemoteAddr())
+	}
+}
+
+func TestAcceptRejectsMalformedHeaderWithoutLeakingClosedConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	good, goodClient := net.Pipe()
+	defer goodClient.Close()
+
+	inner := &pipeListener{conns: make(chan net.Conn, 2)}
+	inner.conns <- server
+	inner.conns <- good
+
+	l := &Listener{Listener: inner, Mode: Optional}
+
+	go func() {
+		// A v2 signature promising more header than is ever sent;
+		// ReadFull will fail, which previously still resulted in the
+		// (now-closed) connection being returned from Accept.
+		client.Write(v2Signature)
+		client.Close()
+	}()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		goodClient.Write([]byte("hello!"))
+		goodClient.Close()
+	}()
+
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept returned an error instead of moving on to the next connection: %v", err)
+	}
+	// Accept always wraps the passed-through net.Conn in a *conn, so
+	// unwrap before comparing identity with the raw connection.
+	wrapped, ok := accepted.(*conn)
+	if !ok {
+		t.Fatalf("Accept returned a %T, want *conn", accepted)
+	}
+	if wrapped.Conn != good {
+		t.Fatalf("Accept returned the malformed/closed connection instead of the next good one")
+	}
+}
@@ -0,0 +1,126 @@
+// Package statestore persists the per-file "checked" state shown in the
+// directory listing, keyed by the per-entry path hash the listing emits, and
+// fans out changes to subscribers so a WebSocket frontend can replace the
+// Firebase realtime database previously used for this purpose.
+package statestore
+
+import (
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("state")
+
+// Store is a bbolt-backed key/value store of bool state, with in-process
+// pub/sub. It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+
+	mu   sync.Mutex
+	subs map[string][]chan bool
+}
+
+// Open opens (creating if necessary) a bbolt database at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{
+		db:   db,
+		subs: make(map[string][]chan bool),
+	}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the current value for key, defaulting to false if unset.
+func (s *Store) Get(key string) (bool, error) {
+	var value bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName).Get([]byte(key))
+		value = len(b) == 1 && b[0] == 1
+		return nil
+	})
+	return value, err
+}
+
+// Set persists value for key and notifies any subscribers.
+func (s *Store) Set(key string, value bool) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := []byte{0}
+		if value {
+			b[0] = 1
+		}
+		return tx.Bucket(bucketName).Put([]byte(key), b)
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(key, value)
+	return nil
+}
+
+// Subscribe returns a channel that immediately receives the current value
+// of key, and again every time it changes thereafter. The channel must be
+// passed to Unsubscribe once the caller is done with it.
+func (s *Store) Subscribe(key string) <-chan bool {
+	ch := make(chan bool, 1)
+
+	s.mu.Lock()
+	s.subs[key] = append(s.subs[key], ch)
+	s.mu.Unlock()
+
+	if value, err := s.Get(key); err == nil {
+		ch <- value
+	}
+	return ch
+}
+
+// Unsubscribe releases a channel previously returned by Subscribe.
+func (s *Store) Unsubscribe(key string, ch <-chan bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chans := s.subs[key]
+	for i, c := range chans {
+		if c == ch {
+			s.subs[key] = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Store) publish(key string, value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.subs[key] {
+		select {
+		case ch <- value:
+		default:
+			// The buffered slot is still full (e.g. the initial value
+			// pushed by Subscribe hasn't been drained yet). There's no
+			// ordering to preserve for a bool, so replace the pending
+			// value with the current one instead of dropping this
+			// update and leaving the subscriber stuck on a stale value.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- value:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package statestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSetReplacesStalePendingValueInsteadOfDroppingIt(t *testing.T) {
+	s := openTestStore(t)
+
+	ch := s.Subscribe("a")
+	defer s.Unsubscribe("a", ch)
+
+	// Subscribe already filled the buffered slot with the initial (false)
+	// value, without anyone having drained it yet. A Set here must not
+	// silently drop its update.
+	if err := s.Set("a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-ch:
+		if !got {
+			t.Fatal("subscriber observed the stale initial value instead of the update")
+		}
+	default:
+		t.Fatal("Set dropped its update instead of replacing the pending value")
+	}
+}
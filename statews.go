@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/interarticle/gofileserver/statestore"
+)
+
+const (
+	stateWSPongWait   = 60 * time.Second
+	stateWSPingPeriod = 54 * time.Second
+)
+
+var stateWSUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// stateWSMessage is the {op, key, value} frame exchanged with clients: "sub"
+// requests (and "set" pushes) the current value for key, "set" changes it.
+type stateWSMessage struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value bool   `json:"value"`
+}
+
+// stateWSHandler serves /api/state/ws, backing the listing template's
+// per-file "checked" checkboxes with store instead of Firebase.
+type stateWSHandler struct {
+	store *statestore.Store
+}
+
+func newStateWSHandler(store *statestore.Store) *stateWSHandler {
+	return &stateWSHandler{store: store}
+}
+
+func (h *stateWSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := stateWSUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("statews: upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(stateWSPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(stateWSPongWait))
+		return nil
+	})
+
+	var writeMu sync.Mutex
+	writeJSON := func(v interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(stateWSPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				writeMu.Lock()
+				err := conn.WriteMessage(websocket.PingMessage, nil)
+				writeMu.Unlock()
+				if err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	subs := make(map[string]<-chan bool)
+	defer func() {
+		for key, ch := range subs {
+			h.store.Unsubscribe(key, ch)
+		}
+	}()
+
+	for {
+		var msg stateWSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Op {
+		case "sub":
+			if _, ok := subs[msg.Key]; ok {
+				continue
+			}
+			ch := h.store.Subscribe(msg.Key)
+			subs[msg.Key] = ch
+			go h.pushUpdates(msg.Key, ch, done, writeJSON)
+		case "set":
+			if err := h.store.Set(msg.Key, msg.Value); err != nil {
+				log.Printf("statews: failed to set %q: %v", msg.Key, err)
+			}
+		}
+	}
+}
+
+func (h *stateWSHandler) pushUpdates(key string, ch <-chan bool, done <-chan struct{}, writeJSON func(interface{}) error) {
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeJSON(stateWSMessage{Op: "set", Key: key, Value: value}); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var errWriteForbidden = errors.New("missing or invalid signature")
+
+// verifyWriteSignature checks the ?sig=&exp= query parameters against
+// sha256(PathHashHMACKey), gating PUT/POST/DELETE the same way
+// PathHashHMACKey gates the per-file hashes in the listing template. sig is
+// base64(hmac-sha256(method|path|exp)).
+func (s *betterHttpListingServer) verifyWriteSignature(r *http.Request, method, p string) error {
+	if s.hmacKey == nil {
+		return errors.New("writes are disabled: path_hash_hmac_key is not set")
+	}
+
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	expStr := q.Get("exp")
+	if sig == "" || expStr == "" {
+		return errWriteForbidden
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return errWriteForbidden
+	}
+	if time.Now().Unix() > exp {
+		return errWriteForbidden
+	}
+
+	mac := hmac.New(sha256.New, s.hmacKey)
+	mac.Write([]byte(method + "|" + p + "|" + expStr))
+	wantSig := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(wantSig)) {
+		return errWriteForbidden
+	}
+	return nil
+}
+
+// writeAtomic streams src to a sibling temp file and renames it over
+// finalPath on success, so readers never observe a partially-written file.
+// The temp file is removed if src can't be fully read or the rename fails.
+func writeAtomic(finalPath string, src io.Reader) (err error) {
+	dir := filepath.Dir(finalPath)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(finalPath)+".tmp.*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, finalPath)
+}
+
+func (s *betterHttpListingServer) handlePut(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	if err := s.verifyWriteSignature(r, http.MethodPut, p); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if s.rootDir == "" {
+		http.Error(w, "writes require a filesystem-backed root", http.StatusInternalServerError)
+		return
+	}
+
+	finalPath := filepath.Join(s.rootDir, filepath.FromSlash(p))
+	if err := writeAtomic(finalPath, r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, p)
+}
+
+// handlePost accepts a multipart/form-data POST to a directory path,
+// writing each file part into that directory.
+func (s *betterHttpListingServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	if err := s.verifyWriteSignature(r, http.MethodPost, p); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if s.rootDir == "" {
+		http.Error(w, "writes require a filesystem-backed root", http.StatusInternalServerError)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var written []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := part.FileName()
+		if name == "" {
+			continue
+		}
+		base := filepath.Base(name)
+		if base == "." || base == ".." {
+			http.Error(w, "invalid filename: "+name, http.StatusBadRequest)
+			return
+		}
+
+		finalPath := filepath.Join(s.rootDir, filepath.FromSlash(p), base)
+		if err := writeAtomic(finalPath, part); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		written = append(written, path.Join(p, base))
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	for _, name := range written {
+		fmt.Fprintln(w, name)
+	}
+}
+
+func (s *betterHttpListingServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	if err := s.verifyWriteSignature(r, http.MethodDelete, p); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if s.rootDir == "" {
+		http.Error(w, "writes require a filesystem-backed root", http.StatusInternalServerError)
+		return
+	}
+
+	finalPath := filepath.Join(s.rootDir, filepath.FromSlash(p))
+	if err := os.Remove(finalPath); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandlePostRejectsDotDotFilename(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofileserver-upload-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	key := []byte("test-key")
+	s := &betterHttpListingServer{rootDir: root, hmacKey: key}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	expStr := strconv.FormatInt(exp, 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(http.MethodPost + "|/|" + expStr))
+	sig := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("payload"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/?sig="+sig+"&exp="+expStr, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	s.handlePost(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a \"..\" filename, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected nothing written under root, found %v", entries)
+	}
+}